@@ -0,0 +1,109 @@
+// Command gvproxy-client drives gvproxy's services API from the command
+// line, e.g. to add or remove SSH reverse forwards on a running gvproxy
+// process without restarting it.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/containers/gvisor-tap-vsock/pkg/client"
+	"github.com/containers/gvisor-tap-vsock/pkg/transport"
+	"github.com/containers/gvisor-tap-vsock/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+	case "ssh-forward-list":
+		sshForwardList(os.Args[2:])
+	case "ssh-forward-add":
+		sshForwardAdd(os.Args[2:])
+	case "ssh-forward-remove":
+		sshForwardRemove(os.Args[2:])
+	default:
+		usage()
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: gvproxy-client <ssh-forward-list|ssh-forward-add|ssh-forward-remove> [flags]")
+}
+
+func sshForwardList(args []string) {
+	fs := flag.NewFlagSet("ssh-forward-list", flag.ExitOnError)
+	endpoint := fs.String("endpoint", transport.DefaultURL, "gvproxy services endpoint")
+	_ = fs.Parse(args)
+
+	forwards, err := client.NewSSHForwardClient(*endpoint).List(context.Background())
+	if err != nil {
+		exitWithError(err)
+	}
+	printJSON(forwards)
+}
+
+func sshForwardAdd(args []string) {
+	fs := flag.NewFlagSet("ssh-forward-add", flag.ExitOnError)
+	endpoint := fs.String("endpoint", transport.DefaultURL, "gvproxy services endpoint")
+	source := fs.String("source", "", "Forward listen URL, e.g. tcp://127.0.0.1:2223")
+	destination := fs.String("destination", "", "Destination ssh:// URL inside the guest")
+	identity := fs.String("identity", "", "Path to the SSH identity key")
+	passphrase := fs.String("passphrase", "", "Passphrase for the identity key (sent to gvproxy, which loads the key without it)")
+	hostKeyPin := fs.String("host-key-pin", "", "Path to a known_hosts file pinning the bastion's host key")
+	_ = fs.Parse(args)
+
+	if *source == "" || *destination == "" {
+		exitWithError(fmt.Errorf("-source and -destination are required"))
+	}
+
+	descriptor := types.SSHForwardDescriptor{
+		Source:      *source,
+		Destination: *destination,
+		Identity:    *identity,
+		Passphrase:  *passphrase,
+		HostKeyPin:  *hostKeyPin,
+	}
+
+	info, err := client.NewSSHForwardClient(*endpoint).Create(context.Background(), descriptor)
+	if err != nil {
+		exitWithError(err)
+	}
+	printJSON(info)
+}
+
+func sshForwardRemove(args []string) {
+	fs := flag.NewFlagSet("ssh-forward-remove", flag.ExitOnError)
+	endpoint := fs.String("endpoint", transport.DefaultURL, "gvproxy services endpoint")
+	id := fs.String("id", "", "Forward id, as returned by ssh-forward-add/ssh-forward-list")
+	_ = fs.Parse(args)
+
+	if *id == "" {
+		exitWithError(fmt.Errorf("-id is required"))
+	}
+
+	if err := client.NewSSHForwardClient(*endpoint).Delete(context.Background(), *id); err != nil {
+		exitWithError(err)
+	}
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		exitWithError(err)
+	}
+}
+
+func exitWithError(err error) {
+	log.Error(err)
+	os.Exit(1)
+}
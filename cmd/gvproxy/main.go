@@ -14,6 +14,8 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/containers/gvisor-tap-vsock/pkg/socks5"
+	"github.com/containers/gvisor-tap-vsock/pkg/sshserver"
 	"github.com/containers/gvisor-tap-vsock/pkg/transport"
 	"github.com/containers/gvisor-tap-vsock/pkg/types"
 	"github.com/containers/gvisor-tap-vsock/pkg/virtualnetwork"
@@ -24,18 +26,25 @@ import (
 )
 
 var (
-	debug           bool
-	mtu             int
-	endpoints       arrayFlags
-	vpnkitSocket    string
-	qemuSocket      string
-	forwardSocket   string
-	forwardDest     string
-	forwardUser     string
-	forwardIdentify string
-	sshPort         int
-	pidFile         string
-	exitCode        int
+	debug             bool
+	mtu               int
+	endpoints         arrayFlags
+	vpnkitSocket      string
+	qemuSocket        string
+	forwardSocket     string
+	forwardListen     arrayFlags
+	forwardDest       string
+	forwardUser       string
+	forwardIdentify   string
+	sshPort           int
+	pidFile           string
+	exitCode          int
+	listenSSH         string
+	sshHostKey        string
+	sshAuthorizedKeys string
+	listenSocks       string
+	socksUser         string
+	socksPassword     string
 )
 
 func main() {
@@ -46,10 +55,17 @@ func main() {
 	flag.StringVar(&vpnkitSocket, "listen-vpnkit", "", "VPNKit socket to be used by Hyperkit")
 	flag.StringVar(&qemuSocket, "listen-qemu", "", "Socket to be used by Qemu")
 	flag.StringVar(&forwardSocket, "forward-sock", "", "Forwards a unix socket to the guest virtual machine over SSH")
+	flag.Var(&forwardListen, "forward-listen", "Forwards a unix, tcp, or vsock source (e.g. tcp://127.0.0.1:2223) to the guest virtual machine over SSH. Repeatable; all values share one bastion connection")
 	flag.StringVar(&forwardDest, "forward-dest", "", "Forwards a unix socket to the guest virtual machine over SSH")
 	flag.StringVar(&forwardUser, "forward-user", "", "SSH user to use for unix socket forward")
 	flag.StringVar(&forwardIdentify, "forward-identity", "", "Path to SSH identity key for forwarding")
 	flag.StringVar(&pidFile, "pid-file", "", "Generate a file with the PID in it")
+	flag.StringVar(&listenSSH, "listen-ssh", "", "Accept ssh -R reverse forwards on this address, e.g. tcp://0.0.0.0:2223")
+	flag.StringVar(&sshHostKey, "ssh-host-key", "", "Path to the persisted host key for --listen-ssh (generated on first use)")
+	flag.StringVar(&sshAuthorizedKeys, "ssh-authorized-keys", "", "Path to an authorized_keys file for --listen-ssh")
+	flag.StringVar(&listenSocks, "listen-socks", "", "Expose a SOCKS5 proxy into the virtual network on this address, e.g. 127.0.0.1:1080")
+	flag.StringVar(&socksUser, "socks-user", "", "Require this username for SOCKS5 auth (requires --socks-password)")
+	flag.StringVar(&socksPassword, "socks-password", "", "Require this password for SOCKS5 auth (requires --socks-user)")
 	flag.Parse()
 	ctx, cancel := context.WithCancel(context.Background())
 	// Make this the last defer statement in the stack
@@ -111,6 +127,14 @@ func main() {
 		exitWithError(errors.New("-forward-sock, --forward-dest, --forward-user, and --forward-identity must all be specified together, or none specified"))
 	}
 
+	if listenSSH != "" && (sshHostKey == "" || sshAuthorizedKeys == "") {
+		exitWithError(errors.New("--listen-ssh requires --ssh-host-key and --ssh-authorized-keys"))
+	}
+
+	if (socksUser == "") != (socksPassword == "") {
+		exitWithError(errors.New("--socks-user and --socks-password must be specified together"))
+	}
+
 	// Create a PID file if requested
 	if len(pidFile) > 0 {
 		f, err := os.Create(pidFile)
@@ -228,6 +252,8 @@ func run(ctx context.Context, g *errgroup.Group, configuration *types.Configurat
 	}
 	log.Info("waiting for clients...")
 
+	sshForwards := virtualnetwork.NewSSHForwardRegistry(ctx, vn)
+
 	for _, endpoint := range endpoints {
 		log.Infof("listening %s", endpoint)
 		ln, err := transport.Listen(endpoint)
@@ -239,7 +265,7 @@ func run(ctx context.Context, g *errgroup.Group, configuration *types.Configurat
 			return ln.Close()
 		})
 		g.Go(func() error {
-			err := http.Serve(ln, withProfiler(vn))
+			err := http.Serve(ln, withProfiler(vn, sshForwards))
 			if err != nil {
 				if err != http.ErrServerClosed {
 					return err
@@ -324,7 +350,7 @@ func run(ctx context.Context, g *errgroup.Group, configuration *types.Configurat
 		}
 		g.Go(func() error {
 			defer os.Remove(forwardSocket)
-			forward, err := virtualnetwork.CreateSSHForward(ctx, forwardSocket, dest, forwardIdentify, vn)
+			forward, err := virtualnetwork.CreateSSHForward(ctx, forwardSocket, dest, forwardIdentify, vn, nil)
 			if err != nil {
 				return err
 			}
@@ -350,11 +376,95 @@ func run(ctx context.Context, g *errgroup.Group, configuration *types.Configurat
 		})
 	}
 
+	if len(forwardListen) > 0 {
+		dest := url.URL{
+			Scheme: "ssh",
+			User:   url.User(forwardUser),
+			Host:   configuration.SSHHostPort,
+			Path:   forwardDest,
+		}
+		g.Go(func() error {
+			primary, err := virtualnetwork.CreateSSHForwardFromSource(ctx, forwardListen[0], dest, forwardIdentify, vn, nil)
+			if err != nil {
+				return err
+			}
+			forwards := []*virtualnetwork.SSHForward{primary}
+			for _, source := range forwardListen[1:] {
+				forward, err := primary.AddListener(source)
+				if err != nil {
+					return err
+				}
+				forwards = append(forwards, forward)
+			}
+
+			go func() {
+				<-ctx.Done()
+				// Abort pending accepts
+				for _, forward := range forwards {
+					forward.Close()
+				}
+			}()
+
+			for _, forward := range forwards {
+				forward := forward
+				g.Go(func() error {
+				loop:
+					for {
+						select {
+						case <-ctx.Done():
+							break loop
+						default:
+							// proceed
+						}
+						if err := forward.AcceptAndTunnel(ctx); err != nil {
+							log.Debugf("Error occurred handling ssh forwarded connection: %q", err)
+						}
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+	}
+
+	if listenSSH != "" {
+		server, err := sshserver.New(sshserver.Config{
+			Listen:             listenSSH,
+			HostKeyPath:        sshHostKey,
+			AuthorizedKeysPath: sshAuthorizedKeys,
+			VN:                 vn,
+		})
+		if err != nil {
+			return errors.Wrap(err, "cannot start ssh server")
+		}
+		g.Go(func() error {
+			return server.ListenAndServe(ctx)
+		})
+	}
+
+	if listenSocks != "" {
+		server, err := socks5.New(socks5.Config{
+			Listen:   listenSocks,
+			VN:       vn,
+			DNS:      configuration.DNS,
+			Username: socksUser,
+			Password: socksPassword,
+		})
+		if err != nil {
+			return errors.Wrap(err, "cannot start socks5 server")
+		}
+		g.Go(func() error {
+			return server.ListenAndServe(ctx)
+		})
+	}
+
 	return nil
 }
 
-func withProfiler(vn *virtualnetwork.VirtualNetwork) http.Handler {
+func withProfiler(vn *virtualnetwork.VirtualNetwork, sshForwards *virtualnetwork.SSHForwardRegistry) http.Handler {
 	mux := vn.Mux()
+	sshForwards.RegisterHandlers(mux)
+	vn.RegisterExposeHandlers(mux)
 	if debug {
 		mux.HandleFunc("/debug/pprof/", pprof.Index)
 		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
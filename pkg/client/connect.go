@@ -0,0 +1,108 @@
+// Package client provides helpers for the agent side of gvproxy: attaching
+// to a virtual network's tap endpoint and driving its HTTP API.
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/containers/gvisor-tap-vsock/pkg/transport"
+	"github.com/sirupsen/logrus"
+)
+
+// AttachOptions configures Attach's reconnect behavior.
+type AttachOptions struct {
+	// InitialBackoff is the delay before the first retry. Defaults to 1s.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the exponential backoff between retries. Defaults to 30s.
+	MaxBackoff time.Duration
+}
+
+func (o AttachOptions) withDefaults() AttachOptions {
+	if o.InitialBackoff <= 0 {
+		o.InitialBackoff = time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 30 * time.Second
+	}
+	return o
+}
+
+// Attach dials endpoint (typically a ws://, wss://, or https+connect:// URL
+// so the agent only needs outbound HTTPS) and delivers each successful
+// connection on the returned channel. On disconnect it automatically
+// redials with exponential backoff until ctx is canceled, so callers can
+// simply range over the channel and resume framing a fresh net.Conn each
+// time one arrives.
+func Attach(ctx context.Context, endpoint string, opts AttachOptions) <-chan net.Conn {
+	opts = opts.withDefaults()
+	conns := make(chan net.Conn)
+
+	go func() {
+		defer close(conns)
+		backoff := opts.InitialBackoff
+
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+
+			conn, err := transport.Dial(endpoint)
+			if err != nil {
+				logrus.Debugf("client: failed to attach to %s: %s, retrying in %s", endpoint, err, backoff)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				backoff = nextBackoff(backoff, opts.MaxBackoff)
+				continue
+			}
+
+			backoff = opts.InitialBackoff
+			wrapped := &notifyClose{Conn: conn, closed: make(chan struct{})}
+
+			select {
+			case conns <- wrapped:
+			case <-ctx.Done():
+				conn.Close()
+				return
+			}
+
+			// Wait for the caller to finish with this connection (it closes
+			// it when framing returns EOF or errors out) before redialing.
+			select {
+			case <-wrapped.closed:
+			case <-ctx.Done():
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	return conns
+}
+
+// notifyClose signals on closed the first time Close is called, so Attach's
+// reconnect loop knows when it's safe to redial.
+type notifyClose struct {
+	net.Conn
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (c *notifyClose) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { close(c.closed) })
+	return err
+}
+
+func nextBackoff(current, max time.Duration) time.Duration {
+	next := current * 2
+	if next > max {
+		next = max
+	}
+	return next
+}
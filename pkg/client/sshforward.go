@@ -0,0 +1,114 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+
+	"github.com/containers/gvisor-tap-vsock/pkg/transport"
+	"github.com/containers/gvisor-tap-vsock/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// SSHForwardClient drives the /services/forwarder/ssh API exposed on a
+// gvproxy services endpoint (the same unix/tcp/vsock/ws URL passed to
+// --listen), so callers can manage reverse forwards without shelling out to
+// curl against a unix socket.
+type SSHForwardClient struct {
+	endpoint string
+	http     *http.Client
+}
+
+// NewSSHForwardClient builds a client that dials endpoint on every request,
+// the same way Attach does.
+func NewSSHForwardClient(endpoint string) *SSHForwardClient {
+	return &SSHForwardClient{
+		endpoint: endpoint,
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+					return transport.Dial(endpoint)
+				},
+			},
+		},
+	}
+}
+
+// List returns the currently registered forwards.
+func (c *SSHForwardClient) List(ctx context.Context) ([]types.SSHForwardInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url("/services/forwarder/ssh"), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var infos []types.SSHForwardInfo
+	if err := json.NewDecoder(resp.Body).Decode(&infos); err != nil {
+		return nil, errors.Wrap(err, "failed to decode response")
+	}
+	return infos, nil
+}
+
+// Create registers a new forward and returns its assigned id and fingerprint.
+func (c *SSHForwardClient) Create(ctx context.Context, descriptor types.SSHForwardDescriptor) (types.SSHForwardInfo, error) {
+	body, err := json.Marshal(descriptor)
+	if err != nil {
+		return types.SSHForwardInfo{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url("/services/forwarder/ssh"), bytes.NewReader(body))
+	if err != nil {
+		return types.SSHForwardInfo{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req, http.StatusCreated)
+	if err != nil {
+		return types.SSHForwardInfo{}, err
+	}
+	defer resp.Body.Close()
+
+	var info types.SSHForwardInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return types.SSHForwardInfo{}, errors.Wrap(err, "failed to decode response")
+	}
+	return info, nil
+}
+
+// Delete tears down the forward with the given id.
+func (c *SSHForwardClient) Delete(ctx context.Context, id string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.url("/services/forwarder/ssh/"+id), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *SSHForwardClient) url(path string) string {
+	return "http://gvproxy" + path
+}
+
+func (c *SSHForwardClient) do(req *http.Request, want int) (*http.Response, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to reach %s", c.endpoint)
+	}
+	if resp.StatusCode != want {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return resp, nil
+}
@@ -0,0 +1,9 @@
+package socks5
+
+import "github.com/pkg/errors"
+
+var (
+	errShortUDPDatagram       = errors.New("socks5: UDP datagram too short")
+	errFragmentedUDP          = errors.New("socks5: fragmented UDP datagrams are not supported")
+	errUnsupportedAddressType = errors.New("socks5: unsupported address type")
+)
@@ -0,0 +1,162 @@
+package socks5
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// negotiate performs the RFC 1928 method selection, and the RFC 1929
+// username/password sub-negotiation when the server requires auth. It
+// returns a reader positioned right after negotiation, ready for readRequest.
+func (s *Server) negotiate(conn net.Conn) (*bufio.Reader, error) {
+	r := bufio.NewReader(conn)
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[0] != version5 {
+		return nil, errors.Errorf("unsupported socks version: %d", header[0])
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return nil, err
+	}
+
+	want := byte(authNone)
+	if s.requireAuth() {
+		want = authPassword
+	}
+
+	offered := false
+	for _, m := range methods {
+		if m == want {
+			offered = true
+			break
+		}
+	}
+	if !offered {
+		conn.Write([]byte{version5, authNoAcceptable})
+		return nil, errors.New("client did not offer an acceptable auth method")
+	}
+
+	if _, err := conn.Write([]byte{version5, want}); err != nil {
+		return nil, err
+	}
+
+	if want == authNone {
+		return r, nil
+	}
+	return r, s.authenticate(r, conn)
+}
+
+func (s *Server) authenticate(r *bufio.Reader, conn net.Conn) error {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+	user := make([]byte, header[1])
+	if _, err := io.ReadFull(r, user); err != nil {
+		return err
+	}
+
+	passLen := make([]byte, 1)
+	if _, err := io.ReadFull(r, passLen); err != nil {
+		return err
+	}
+	pass := make([]byte, passLen[0])
+	if _, err := io.ReadFull(r, pass); err != nil {
+		return err
+	}
+
+	ok := string(user) == s.config.Username && string(pass) == s.config.Password
+	status := byte(0x00)
+	if !ok {
+		status = 0x01
+	}
+	if _, err := conn.Write([]byte{0x01, status}); err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("invalid username/password")
+	}
+	return nil
+}
+
+// readRequest parses the RFC 1928 §4 request after negotiation: version, cmd,
+// reserved, address type, address, port.
+func readRequest(r io.Reader) (cmd byte, addr string, port uint16, err error) {
+	header := make([]byte, 4)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return
+	}
+	if header[0] != version5 {
+		err = errors.Errorf("unsupported socks version: %d", header[0])
+		return
+	}
+	cmd = header[1]
+
+	switch header[3] {
+	case atypIPv4:
+		raw := make([]byte, 4)
+		if _, err = io.ReadFull(r, raw); err != nil {
+			return
+		}
+		addr = net.IP(raw).String()
+	case atypIPv6:
+		raw := make([]byte, 16)
+		if _, err = io.ReadFull(r, raw); err != nil {
+			return
+		}
+		addr = net.IP(raw).String()
+	case atypDomain:
+		l := make([]byte, 1)
+		if _, err = io.ReadFull(r, l); err != nil {
+			return
+		}
+		raw := make([]byte, l[0])
+		if _, err = io.ReadFull(r, raw); err != nil {
+			return
+		}
+		addr = string(raw)
+	default:
+		err = errors.Errorf("unsupported address type: %d", header[3])
+		return
+	}
+
+	portRaw := make([]byte, 2)
+	if _, err = io.ReadFull(r, portRaw); err != nil {
+		return
+	}
+	port = binary.BigEndian.Uint16(portRaw)
+	return
+}
+
+// writeReply writes the RFC 1928 §6 reply. boundAddr/boundPort describe the
+// address the server is now relaying from: CONNECT and error replies pass
+// the zero address, UDP ASSOCIATE passes the relay socket's bound address.
+// The reply is always encoded as IPv4.
+func writeReply(conn net.Conn, rep byte, boundAddr net.IP, boundPort uint16) error {
+	reply := []byte{version5, rep, 0x00, atypIPv4}
+	if boundAddr == nil {
+		boundAddr = net.IPv4zero
+	}
+	reply = append(reply, boundAddr.To4()...)
+	portRaw := make([]byte, 2)
+	binary.BigEndian.PutUint16(portRaw, boundPort)
+	reply = append(reply, portRaw...)
+	_, err := conn.Write(reply)
+	return err
+}
+
+func copyAndClose(dst io.Writer, src io.Reader) {
+	io.Copy(dst, src)
+	if closer, ok := dst.(interface{ CloseWrite() error }); ok {
+		closer.CloseWrite()
+	}
+}
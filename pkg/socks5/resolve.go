@@ -0,0 +1,39 @@
+package socks5
+
+import (
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// resolve turns a SOCKS5 request address into an IP address string. Addresses that
+// were already literal IPs pass straight through; domain names are matched
+// against the configured DNS zones (the same ones the virtual network's own
+// resolver serves, e.g. "host.containers.internal") so names used inside the
+// guest work transparently for host clients too. This is not a general
+// resolver: a name outside the configured zones fails here rather than
+// falling through to the guest's own DNS, so ordinary internet hostnames
+// only work with --socks5-hostname style clients when the name happens to be
+// one of these zone records.
+func (s *Server) resolve(addr string) (string, error) {
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip.String(), nil
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(addr, "."))
+	for _, zone := range s.config.DNS {
+		zoneName := strings.ToLower(strings.TrimSuffix(zone.Name, "."))
+		for _, record := range zone.Records {
+			fqdn := record.Name
+			if zoneName != "" {
+				fqdn = fqdn + "." + zoneName
+			}
+			if fqdn == name {
+				return record.IP.String(), nil
+			}
+		}
+	}
+
+	return "", errors.Errorf("no DNS zone record for %q", addr)
+}
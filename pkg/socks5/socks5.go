@@ -0,0 +1,161 @@
+// Package socks5 implements a SOCKS5 proxy (RFC 1928) that dials through a
+// virtualnetwork.VirtualNetwork's gvisor stack instead of the host's own
+// network, so that host tools (curl, browsers, kubectl, ...) can reach the
+// virtual subnet and the guest with no VM-side changes. Name resolution is
+// limited to literal IPs and the zones in Config.DNS - see resolve.go - so
+// callers that need ordinary internet hostnames should resolve on the host
+// and connect by IP, or CONNECT/ASSOCIATE to a name defined in one of those
+// zones.
+package socks5
+
+import (
+	"context"
+	"net"
+
+	"github.com/containers/gvisor-tap-vsock/pkg/types"
+	"github.com/containers/gvisor-tap-vsock/pkg/virtualnetwork"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	version5 = 0x05
+
+	authNone         = 0x00
+	authPassword     = 0x02
+	authNoAcceptable = 0xFF
+
+	cmdConnect      = 0x01
+	cmdUDPAssociate = 0x03
+
+	atypIPv4   = 0x01
+	atypDomain = 0x03
+	atypIPv6   = 0x04
+
+	repSucceeded           = 0x00
+	repGeneralFailure      = 0x01
+	repCommandNotSupported = 0x07
+	repAddressNotSupported = 0x08
+)
+
+// Config describes how to bring up the SOCKS5 front-end.
+type Config struct {
+	// Listen is the host address the proxy accepts connections on, e.g. "127.0.0.1:1080".
+	Listen string
+	// VN is the virtual network that CONNECT/UDP ASSOCIATE dial into.
+	VN *virtualnetwork.VirtualNetwork
+	// DNS are the zones used to resolve domain-name requests, mirroring
+	// the configuration's own resolver (e.g. host.containers.internal).
+	// Names outside these zones are not resolved - see resolve.go.
+	DNS []types.Zone
+	// Username/Password, if both set, require RFC 1929 auth.
+	Username string
+	Password string
+}
+
+// Server is a SOCKS5 proxy bridging host clients into a virtual network.
+type Server struct {
+	config   Config
+	listener net.Listener
+}
+
+// New prepares a Server. It does not start listening; call ListenAndServe
+// for that.
+func New(cfg Config) (*Server, error) {
+	if cfg.VN == nil {
+		return nil, errors.New("socks5: Config.VN is required")
+	}
+	return &Server{config: cfg}, nil
+}
+
+// ListenAndServe binds cfg.Listen and serves SOCKS5 clients until ctx is canceled.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.config.Listen)
+	if err != nil {
+		return errors.Wrapf(err, "socks5: cannot listen on %s", s.config.Listen)
+	}
+	s.listener = ln
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			default:
+			}
+			return errors.Wrap(err, "socks5: accept error")
+		}
+		go s.handleConn(ctx, conn)
+	}
+}
+
+func (s *Server) requireAuth() bool {
+	return s.config.Username != "" && s.config.Password != ""
+}
+
+func (s *Server) handleConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	r, err := s.negotiate(conn)
+	if err != nil {
+		logrus.Debugf("socks5: negotiation failed: %s", err)
+		return
+	}
+
+	cmd, addr, port, err := readRequest(r)
+	if err != nil {
+		logrus.Debugf("socks5: malformed request: %s", err)
+		writeReply(conn, repGeneralFailure, nil, 0)
+		return
+	}
+
+	switch cmd {
+	case cmdConnect:
+		ip, err := s.resolve(addr)
+		if err != nil {
+			logrus.Debugf("socks5: could not resolve %s: %s", addr, err)
+			writeReply(conn, repAddressNotSupported, nil, 0)
+			return
+		}
+		s.handleConnect(ctx, conn, ip, port)
+	case cmdUDPAssociate:
+		// addr/port here are the client's own advertised source, not a
+		// destination - each relayed datagram carries its own destination
+		// that handleUDPAssociate resolves individually.
+		s.handleUDPAssociate(ctx, conn)
+	default:
+		writeReply(conn, repCommandNotSupported, nil, 0)
+	}
+}
+
+func (s *Server) handleConnect(ctx context.Context, conn net.Conn, ip string, port uint16) {
+	dest, err := s.config.VN.DialContextTCP(ctx, ip, port)
+	if err != nil {
+		logrus.Debugf("socks5: CONNECT %s:%d failed: %s", ip, port, err)
+		writeReply(conn, repGeneralFailure, nil, 0)
+		return
+	}
+	defer dest.Close()
+
+	if err := writeReply(conn, repSucceeded, net.ParseIP("0.0.0.0"), 0); err != nil {
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		copyAndClose(dest, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		copyAndClose(conn, dest)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
@@ -0,0 +1,228 @@
+package socks5
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// udpFlowIdleTimeout bounds how long a dialed UDP flow is kept open without
+// any reply activity before it is torn down, so idle flows (a one-shot DNS
+// query, a client that vanished) don't accumulate dialed sockets forever.
+const udpFlowIdleTimeout = 30 * time.Second
+
+// udpFlowKey identifies one client<->destination UDP flow, so repeated
+// datagrams between the same pair reuse a single dialed conn (and therefore
+// see every reply, not just the first) instead of dialing fresh each time.
+type udpFlowKey struct {
+	client string
+	dest   string
+}
+
+// handleUDPAssociate implements RFC 1928 §4's UDP ASSOCIATE: it opens a host
+// UDP socket that the client subsequently sends SOCKS5-framed datagrams to,
+// relays each one's payload to its destination inside the virtual network via
+// gonet, and relays replies back the same way. The TCP connection that asked
+// for the association must stay open for as long as the relay is alive.
+func (s *Server) handleUDPAssociate(ctx context.Context, conn net.Conn) {
+	relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: s.relayBindIP(), Port: 0})
+	if err != nil {
+		logrus.Debugf("socks5: UDP ASSOCIATE relay bind failed: %s", err)
+		writeReply(conn, repGeneralFailure, nil, 0)
+		return
+	}
+	defer relay.Close()
+
+	bound := relay.LocalAddr().(*net.UDPAddr)
+	if err := writeReply(conn, repSucceeded, bound.IP, uint16(bound.Port)); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The control connection being closed (client hangup, or our own
+	// read loop returning on EOF) tears down the relay.
+	go func() {
+		buf := make([]byte, 1)
+		conn.Read(buf) //nolint:errcheck // only used to detect connection close
+		cancel()
+	}()
+	go func() {
+		<-ctx.Done()
+		relay.Close()
+	}()
+
+	var mu sync.Mutex
+	flows := make(map[udpFlowKey]net.Conn)
+	defer func() {
+		mu.Lock()
+		closing := flows
+		flows = nil
+		mu.Unlock()
+		for _, dest := range closing {
+			dest.Close()
+		}
+	}()
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, from, err := relay.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		destAddr, destPort, payload, err := parseUDPRequest(buf[:n])
+		if err != nil {
+			logrus.Debugf("socks5: malformed UDP datagram: %s", err)
+			continue
+		}
+
+		ip, err := s.resolve(destAddr)
+		if err != nil {
+			logrus.Debugf("socks5: UDP could not resolve %s: %s", destAddr, err)
+			continue
+		}
+
+		key := udpFlowKey{client: from.String(), dest: fmt.Sprintf("%s:%d", ip, destPort)}
+
+		mu.Lock()
+		dest, ok := flows[key]
+		if !ok {
+			dest, err = s.config.VN.DialUDP(ip, destPort)
+			if err != nil {
+				mu.Unlock()
+				logrus.Debugf("socks5: UDP dial %s:%d failed: %s", ip, destPort, err)
+				continue
+			}
+			flows[key] = dest
+			go relayUDPReplies(dest, relay, from, destAddr, destPort, func() {
+				mu.Lock()
+				if flows != nil && flows[key] == dest {
+					delete(flows, key)
+				}
+				mu.Unlock()
+			})
+		}
+		mu.Unlock()
+
+		if _, err := dest.Write(payload); err != nil {
+			mu.Lock()
+			if flows != nil && flows[key] == dest {
+				delete(flows, key)
+			}
+			mu.Unlock()
+			dest.Close()
+			continue
+		}
+	}
+}
+
+// relayBindIP returns the interface the UDP relay socket should bind to: the
+// same one the TCP listener accepts ASSOCIATE requests on, so a proxy bound
+// to loopback (e.g. "127.0.0.1:1080") doesn't open an unauthenticated UDP
+// ingress on every host interface. It falls back to all interfaces only if
+// config.Listen's host can't be parsed as an IP (e.g. a bare port).
+func (s *Server) relayBindIP() net.IP {
+	host, _, err := net.SplitHostPort(s.config.Listen)
+	if err != nil {
+		host = s.config.Listen
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip
+	}
+	return net.IPv4zero
+}
+
+// relayUDPReplies reads reply datagrams from dest until it errors or goes
+// idle for udpFlowIdleTimeout, relaying each one back to the SOCKS5 client
+// re-wrapped in the UDP request header, so multi-packet exchanges (not just
+// a single-shot DNS query) work end to end.
+func relayUDPReplies(dest net.Conn, relay *net.UDPConn, client *net.UDPAddr, destAddr string, destPort uint16, onDone func()) {
+	defer onDone()
+	defer dest.Close()
+
+	header := udpRequestHeader(destAddr, destPort)
+	buf := make([]byte, 64*1024)
+	for {
+		if err := dest.SetReadDeadline(time.Now().Add(udpFlowIdleTimeout)); err != nil {
+			return
+		}
+		n, err := dest.Read(buf)
+		if err != nil {
+			return
+		}
+
+		datagram := append(append([]byte{}, header...), buf[:n]...)
+		if _, err := relay.WriteToUDP(datagram, client); err != nil {
+			return
+		}
+	}
+}
+
+// parseUDPRequest parses the RFC 1928 §7 UDP request header: RSV(2) FRAG(1)
+// ATYP DST.ADDR DST.PORT DATA. Fragmentation is not supported; FRAG must be 0.
+func parseUDPRequest(raw []byte) (addr string, port uint16, payload []byte, err error) {
+	if len(raw) < 4 {
+		return "", 0, nil, errShortUDPDatagram
+	}
+	frag := raw[2]
+	atyp := raw[3]
+	raw = raw[4:]
+
+	if frag != 0 {
+		return "", 0, nil, errFragmentedUDP
+	}
+
+	switch atyp {
+	case atypIPv4:
+		if len(raw) < 4+2 {
+			return "", 0, nil, errShortUDPDatagram
+		}
+		addr = net.IP(raw[:4]).String()
+		raw = raw[4:]
+	case atypIPv6:
+		if len(raw) < 16+2 {
+			return "", 0, nil, errShortUDPDatagram
+		}
+		addr = net.IP(raw[:16]).String()
+		raw = raw[16:]
+	case atypDomain:
+		if len(raw) < 1 {
+			return "", 0, nil, errShortUDPDatagram
+		}
+		l := int(raw[0])
+		raw = raw[1:]
+		if len(raw) < l+2 {
+			return "", 0, nil, errShortUDPDatagram
+		}
+		addr = string(raw[:l])
+		raw = raw[l:]
+	default:
+		return "", 0, nil, errUnsupportedAddressType
+	}
+
+	port = binary.BigEndian.Uint16(raw[:2])
+	payload = raw[2:]
+	return addr, port, payload, nil
+}
+
+// udpRequestHeader builds the RFC 1928 §7 header for a reply carrying data
+// from addr:port.
+func udpRequestHeader(addr string, port uint16) []byte {
+	ip := net.ParseIP(addr)
+	header := []byte{0x00, 0x00, 0x00, atypIPv4}
+	if ip4 := ip.To4(); ip4 != nil {
+		header = append(header, ip4...)
+	} else {
+		header = append(header, net.IPv4zero...)
+	}
+	portRaw := make([]byte, 2)
+	binary.BigEndian.PutUint16(portRaw, port)
+	return append(header, portRaw...)
+}
@@ -1,32 +1,27 @@
 package sshclient
 
 import (
-	"bufio"
-	"fmt"
 	"io/ioutil"
 	"net"
 	"net/url"
-	"os"
-	"path/filepath"
 	"strconv"
 	"time"
 
-	"github.com/containers/storage/pkg/homedir"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 // Modified version of podman ssh client library, until a shared module exists
 
 type Bastion struct {
-	Client  *ssh.Client
-	Config  *ssh.ClientConfig
-	Host    string
-	Port    string
-	Path    string
-	connect ConnectCallback
+	Client   *ssh.Client
+	Config   *ssh.ClientConfig
+	Host     string
+	Port     string
+	Path     string
+	connect  ConnectCallback
+	hostKeys HostKeyStore
 }
 
 type ConnectCallback func(bastion *Bastion) (net.Conn, error)
@@ -47,38 +42,13 @@ func PublicKey(path string, passphrase []byte) (ssh.Signer, error) {
 	return signer, nil
 }
 
-func HostKey(host string) ssh.PublicKey {
-	// parse OpenSSH known_hosts file
-	// ssh or use ssh-keyscan to get initial key
-	knownHosts := filepath.Join(homedir.Get(), ".ssh", "known_hosts")
-	fd, err := os.Open(knownHosts)
-	if err != nil {
-		logrus.Error(err)
-		return nil
-	}
-
-	// support -H parameter for ssh-keyscan
-	hashhost := knownhosts.HashHostname(host)
-
-	scanner := bufio.NewScanner(fd)
-	for scanner.Scan() {
-		_, hosts, key, _, _, err := ssh.ParseKnownHosts(scanner.Bytes())
-		if err != nil {
-			logrus.Errorf("Failed to parse known_hosts: %s", scanner.Text())
-			continue
-		}
-
-		for _, h := range hosts {
-			if h == host || h == hashhost {
-				return key
-			}
-		}
-	}
-
-	return nil
-}
-
-func CreateBastion(_url *url.URL, passPhrase string, identity string, initial net.Conn, connect ConnectCallback) (Bastion, error) {
+// CreateBastion dials the SSH bastion at _url. hostKeys picks how its host
+// key is verified across (re)connects; pass nil to fall back to the
+// semantics carried on the URL itself: ?secure=true selects a
+// TOFUHostKeyStore, persisted to the optional ?known-hosts=<path>, and
+// without it any host key is accepted. The user's ~/.ssh/known_hosts is not
+// consulted.
+func CreateBastion(_url *url.URL, passPhrase string, identity string, initial net.Conn, connect ConnectCallback, hostKeys HostKeyStore) (Bastion, error) {
 	var authMethods []ssh.AuthMethod
 
 	if len(identity) > 0 {
@@ -102,27 +72,20 @@ func CreateBastion(_url *url.URL, passPhrase string, identity string, initial ne
 		port = "22"
 	}
 
-	secure, _ := strconv.ParseBool(_url.Query().Get("secure"))
-
-	callback := ssh.InsecureIgnoreHostKey() // #nosec
-	if secure {
-		host := _url.Hostname()
-		if port != "22" {
-			host = fmt.Sprintf("[%s]:%s", host, port)
-		}
-		key := HostKey(host)
-		if key != nil {
-			callback = ssh.FixedHostKey(key)
-		}
+	if hostKeys == nil {
+		hostKeys = defaultHostKeyStore(_url)
 	}
 
 	config := &ssh.ClientConfig{
 		User:            _url.User.Username(),
 		Auth:            authMethods,
-		HostKeyCallback: callback,
+		HostKeyCallback: hostKeys.HostKeyCallback(),
 		HostKeyAlgorithms: []string{
 			ssh.KeyAlgoRSA,
-			ssh.KeyAlgoDSA,
+			// KeyAlgoDSA is deliberately left out: DSA is deprecated and
+			// OpenSSH disables it by default.
+			"rsa-sha2-256",
+			"rsa-sha2-512",
 			ssh.KeyAlgoECDSA256,
 			ssh.KeyAlgoECDSA384,
 			ssh.KeyAlgoECDSA521,
@@ -142,10 +105,17 @@ func CreateBastion(_url *url.URL, passPhrase string, identity string, initial ne
 		}
 	}
 
-	bastion := Bastion{nil, config, _url.Hostname(), port, _url.Path, connect}
+	bastion := Bastion{nil, config, _url.Hostname(), port, _url.Path, connect, hostKeys}
 	return bastion, bastion.reconnect(initial)
 }
 
+// Fingerprint returns the SHA256 fingerprint of the host key that was
+// accepted on the most recent (re)connect, or "" before the first one. It is
+// always "" when host keys are not verified (InsecureHostKeyStore).
+func (bastion *Bastion) Fingerprint() string {
+	return bastion.hostKeys.Fingerprint()
+}
+
 func (bastion *Bastion) Reconnect() error {
 	return bastion.reconnect(nil)
 }
@@ -170,5 +140,21 @@ func (bastion *Bastion) reconnect(conn net.Conn) error {
 		return err
 	}
 	bastion.Client = ssh.NewClient(c, chans, reqs)
+	logrus.Infof("ssh bastion %s host key fingerprint: %s", bastion.Host, bastion.Fingerprint())
 	return nil
 }
+
+func defaultHostKeyStore(_url *url.URL) HostKeyStore {
+	secure, _ := strconv.ParseBool(_url.Query().Get("secure"))
+	if !secure {
+		return InsecureHostKeyStore{}
+	}
+
+	// Unlike FileHostKeyStore, an explicit ?known-hosts= isn't required here:
+	// without one, TOFUHostKeyStore still pins for the lifetime of the
+	// process, it just doesn't persist across restarts. We deliberately
+	// don't fall back to the user's own ~/.ssh/known_hosts - this pin is
+	// managed by gvproxy, not an interactive ssh(1) session, and appending
+	// to that file behind the user's back would be a surprising side effect.
+	return NewTOFUHostKeyStore(_url.Query().Get("known-hosts"))
+}
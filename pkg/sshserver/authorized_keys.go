@@ -0,0 +1,27 @@
+package sshserver
+
+import (
+	"io/ioutil"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// loadAuthorizedKeys parses an OpenSSH authorized_keys file into a set keyed
+// by the marshaled public key, for O(1) lookup from PublicKeyCallback.
+func loadAuthorizedKeys(path string) (map[string]struct{}, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]struct{})
+	for len(raw) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(raw)
+		if err != nil {
+			break
+		}
+		keys[string(key.Marshal())] = struct{}{}
+		raw = rest
+	}
+	return keys, nil
+}
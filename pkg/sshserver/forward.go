@@ -0,0 +1,310 @@
+package sshserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/containers/gvisor-tap-vsock/pkg/types"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// tcpipForward tracks a single active "ssh -R" reverse forward: a listener
+// inside the virtual network whose connections are relayed back to the
+// client as forwarded-tcpip channels.
+type tcpipForward struct {
+	bindAddr string
+	bindPort uint32
+	listener net.Listener
+}
+
+// connForwards tracks the reverse-forward listeners a single SSH connection
+// has asked for, keyed the same way as the wire protocol (bind addr:port).
+// Scoping the map to the connection - rather than the whole Server - means a
+// client's forwards are torn down when it disconnects, and one client can no
+// longer cancel or collide with another's bind address.
+type connForwards struct {
+	mu       sync.Mutex
+	forwards map[string]*tcpipForward
+	// aliases maps a client's original bind key (as sent on the wire) to the
+	// key the forward actually landed under. It only ever has entries for
+	// ephemeral binds (BindPort 0): the client requests "addr:0", the server
+	// picks a real port and replies with it, and a later cancel-tcpip-forward
+	// may reuse either the original "addr:0" or the assigned port depending
+	// on the client - both need to resolve to the same forward.
+	aliases map[string]string
+	// onClose is invoked, for each forward still open, by closeAll - the
+	// path taken when the owning connection disconnects rather than
+	// explicitly canceling a forward. It lets Server unregister the expose
+	// entry without connForwards needing to know about it.
+	onClose func(id string, fwd *tcpipForward)
+}
+
+func newConnForwards(onClose func(id string, fwd *tcpipForward)) *connForwards {
+	return &connForwards{
+		forwards: make(map[string]*tcpipForward),
+		aliases:  make(map[string]string),
+		onClose:  onClose,
+	}
+}
+
+// add records fwd under id. If the client's original request used an
+// ephemeral port (aliasID non-empty, see aliases above), a cancel sent with
+// that original key will also resolve to id.
+func (cf *connForwards) add(id string, fwd *tcpipForward, aliasID string) {
+	cf.mu.Lock()
+	cf.forwards[id] = fwd
+	if aliasID != "" && aliasID != id {
+		cf.aliases[aliasID] = id
+	}
+	cf.mu.Unlock()
+}
+
+// resolve maps a cancel request's raw bind key to the key its forward is
+// actually stored under, following an alias recorded for an ephemeral-port
+// bind if the direct key isn't present.
+func (cf *connForwards) resolve(id string) string {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	if _, ok := cf.forwards[id]; ok {
+		return id
+	}
+	if actual, ok := cf.aliases[id]; ok {
+		return actual
+	}
+	return id
+}
+
+// remove deletes id if it still maps to fwd, returning whether it did, and
+// drops any alias pointing at it. It's keyed on the specific *tcpipForward so
+// a cancel racing a fresh bind to the same address can't remove the wrong
+// forward.
+func (cf *connForwards) remove(id string, fwd *tcpipForward) bool {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	if cf.forwards[id] != fwd {
+		return false
+	}
+	delete(cf.forwards, id)
+	for alias, actual := range cf.aliases {
+		if actual == id {
+			delete(cf.aliases, alias)
+		}
+	}
+	return true
+}
+
+func (cf *connForwards) get(id string) (*tcpipForward, bool) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	fwd, ok := cf.forwards[id]
+	return fwd, ok
+}
+
+// closeAll closes every forward still tracked, empties the maps, and invokes
+// onClose for each one.
+func (cf *connForwards) closeAll() {
+	cf.mu.Lock()
+	forwards := cf.forwards
+	cf.forwards = make(map[string]*tcpipForward)
+	cf.aliases = make(map[string]string)
+	cf.mu.Unlock()
+
+	for id, fwd := range forwards {
+		fwd.listener.Close()
+		if cf.onClose != nil {
+			cf.onClose(id, fwd)
+		}
+	}
+}
+
+// tcpipForwardPayload is the RFC 4254 §7.1 "tcpip-forward"/"cancel-tcpip-forward" payload.
+type tcpipForwardPayload struct {
+	BindAddr string
+	BindPort uint32
+}
+
+// tcpipForwardReply carries back the bound port when BindPort was 0.
+type tcpipForwardReply struct {
+	BoundPort uint32
+}
+
+// forwardedTCPIPPayload is the RFC 4254 §7.2 "forwarded-tcpip" open payload.
+type forwardedTCPIPPayload struct {
+	ConnAddr   string
+	ConnPort   uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+func (s *Server) handleGlobalRequests(ctx context.Context, conn *ssh.ServerConn, cf *connForwards, reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		switch req.Type {
+		case "tcpip-forward":
+			s.handleTCPIPForward(ctx, conn, cf, req)
+		case "cancel-tcpip-forward":
+			s.handleCancelTCPIPForward(cf, req)
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+func (s *Server) handleTCPIPForward(ctx context.Context, conn *ssh.ServerConn, cf *connForwards, req *ssh.Request) {
+	var payload tcpipForwardPayload
+	if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+		if req.WantReply {
+			req.Reply(false, nil)
+		}
+		return
+	}
+
+	ln, err := s.vn.ListenTCP(payload.BindAddr, uint16(payload.BindPort))
+	if err != nil {
+		logrus.Errorf("sshserver: tcpip-forward %s:%d failed: %s", payload.BindAddr, payload.BindPort, err)
+		if req.WantReply {
+			req.Reply(false, nil)
+		}
+		return
+	}
+
+	boundPort := uint32(ln.Addr().(*net.TCPAddr).Port)
+	id := forwardID(payload.BindAddr, boundPort)
+
+	fwd := &tcpipForward{bindAddr: payload.BindAddr, bindPort: boundPort, listener: ln}
+	aliasID := ""
+	if payload.BindPort == 0 {
+		aliasID = forwardID(payload.BindAddr, 0)
+	}
+	cf.add(id, fwd, aliasID)
+
+	revoke := func() {
+		if cf.remove(id, fwd) {
+			fwd.listener.Close()
+		}
+	}
+	if err := s.registerExpose(id, payload.BindAddr, boundPort, revoke); err != nil {
+		logrus.Warnf("sshserver: failed to register forward %s with expose registry: %s", id, err)
+	}
+
+	if req.WantReply {
+		reply := payload.BindPort
+		if reply == 0 {
+			reply = boundPort
+		}
+		req.Reply(true, ssh.Marshal(tcpipForwardReply{BoundPort: reply}))
+	}
+
+	go s.acceptForwarded(ctx, conn, cf, fwd, id)
+}
+
+func (s *Server) handleCancelTCPIPForward(cf *connForwards, req *ssh.Request) {
+	var payload tcpipForwardPayload
+	if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+		if req.WantReply {
+			req.Reply(false, nil)
+		}
+		return
+	}
+
+	// The client may cancel using either the port it originally requested
+	// (0, for an ephemeral bind) or the port the server actually assigned;
+	// resolve follows the alias recorded by handleTCPIPForward so both work.
+	id := cf.resolve(forwardID(payload.BindAddr, payload.BindPort))
+	fwd, ok := cf.get(id)
+	if ok && cf.remove(id, fwd) {
+		fwd.listener.Close()
+		s.unregisterExpose(id, payload.BindAddr, fwd.bindPort)
+	}
+
+	if req.WantReply {
+		req.Reply(ok, nil)
+	}
+}
+
+func (s *Server) acceptForwarded(ctx context.Context, conn *ssh.ServerConn, cf *connForwards, fwd *tcpipForward, id string) {
+	defer func() {
+		if cf.remove(id, fwd) {
+			s.unregisterExpose(id, fwd.bindAddr, fwd.bindPort)
+		}
+	}()
+
+	for {
+		vconn, err := fwd.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		origin, _ := vconn.RemoteAddr().(*net.TCPAddr)
+		payload := forwardedTCPIPPayload{
+			ConnAddr: fwd.bindAddr,
+			ConnPort: fwd.bindPort,
+		}
+		if origin != nil {
+			payload.OriginAddr = origin.IP.String()
+			payload.OriginPort = uint32(origin.Port)
+		}
+
+		channel, requests, err := conn.OpenChannel("forwarded-tcpip", ssh.Marshal(payload))
+		if err != nil {
+			logrus.Debugf("sshserver: client rejected forwarded-tcpip: %s", err)
+			vconn.Close()
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+		go bridge(channel, vconn)
+	}
+}
+
+// registerExpose exposes the forward for API enumeration. revoke is invoked
+// if an API client later deletes the exposed entry, so that doing so
+// actually tears the forward down rather than just hiding it from the list.
+func (s *Server) registerExpose(id, addr string, port uint32, revoke func()) error {
+	if addr == "" {
+		addr = "0.0.0.0"
+	}
+	return s.vn.Expose(&types.ExposeRequest{
+		Local:    fmt.Sprintf("%s:%d", addr, port),
+		Remote:   id,
+		Protocol: types.TCP,
+	}, revoke)
+}
+
+func (s *Server) unregisterExpose(id, addr string, port uint32) {
+	if addr == "" {
+		addr = "0.0.0.0"
+	}
+	_ = s.vn.Unexpose(&types.UnexposeRequest{
+		Local:    fmt.Sprintf("%s:%d", addr, port),
+		Protocol: types.TCP,
+	})
+}
+
+func forwardID(addr string, port uint32) string {
+	return fmt.Sprintf("%s:%d", addr, port)
+}
+
+// bridge copies bytes bidirectionally between an SSH channel and a virtual
+// network connection until either side closes, mirroring the pattern used by
+// virtualnetwork's own SSH forward in ssh_forwarder.go.
+func bridge(channel ssh.Channel, conn net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(channel, conn)
+		channel.CloseWrite()
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, channel)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+	channel.Close()
+	conn.Close()
+}
@@ -0,0 +1,42 @@
+package sshserver
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// loadOrCreateHostKey reads an existing PEM-encoded host key from path, or
+// generates a fresh ed25519 key and persists it there on first start.
+func loadOrCreateHostKey(path string) (ssh.Signer, error) {
+	if path == "" {
+		return nil, errors.New("sshserver: HostKeyPath is required")
+	}
+
+	if raw, err := ioutil.ReadFile(path); err == nil {
+		return ssh.ParsePrivateKey(raw)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate host key")
+	}
+
+	block, err := ssh.MarshalPrivateKey(priv, "gvproxy ssh host key")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, errors.Wrapf(err, "failed to persist host key to %s", path)
+	}
+
+	return ssh.NewSignerFromKey(priv)
+}
@@ -0,0 +1,238 @@
+// Package sshserver lets gvproxy itself accept incoming SSH connections and
+// honor standard `ssh -R host:port:target:port` reverse tunnels, without
+// requiring a separate agent inside the guest. Accepted global requests and
+// channels are bridged into the virtual network via virtualnetwork.VirtualNetwork.
+package sshserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+
+	"github.com/containers/gvisor-tap-vsock/pkg/types"
+	"github.com/containers/gvisor-tap-vsock/pkg/virtualnetwork"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// Config describes how to bring up the SSH front-end.
+type Config struct {
+	// Listen is the address the server accepts connections on, e.g.
+	// "tcp://0.0.0.0:2223" or "unix:///run/gvproxy-ssh.sock".
+	Listen string
+	// HostKeyPath is where the persisted host key is read from, or
+	// generated and written to on first start.
+	HostKeyPath string
+	// AuthorizedKeysPath lists the public keys allowed to authenticate.
+	AuthorizedKeysPath string
+	// VN is the virtual network that forwarded connections dial into.
+	VN *virtualnetwork.VirtualNetwork
+}
+
+// Server is an SSH server that bridges RFC 4254 tcpip-forward/direct-tcpip
+// requests into the virtual network.
+type Server struct {
+	config   *ssh.ServerConfig
+	vn       *virtualnetwork.VirtualNetwork
+	listen   string
+	listener net.Listener
+
+	mu    sync.Mutex
+	conns map[*ssh.ServerConn]*connForwards
+}
+
+// New loads (or creates) the host key and authorized_keys file described by
+// cfg and prepares a Server. It does not start listening; call ListenAndServe
+// for that.
+func New(cfg Config) (*Server, error) {
+	if cfg.VN == nil {
+		return nil, errors.New("sshserver: Config.VN is required")
+	}
+
+	signer, err := loadOrCreateHostKey(cfg.HostKeyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load ssh host key")
+	}
+
+	authorizedKeys, err := loadAuthorizedKeys(cfg.AuthorizedKeysPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load authorized_keys")
+	}
+
+	server := &Server{
+		vn:     cfg.VN,
+		listen: cfg.Listen,
+		conns:  make(map[*ssh.ServerConn]*connForwards),
+	}
+
+	server.config = &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if _, ok := authorizedKeys[string(key.Marshal())]; !ok {
+				return nil, errors.Errorf("unknown public key for %q", conn.User())
+			}
+			return nil, nil
+		},
+	}
+	server.config.AddHostKey(signer)
+
+	return server, nil
+}
+
+// ListenAndServe binds cfg.Listen and accepts connections until ctx is
+// canceled.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	ln, err := listenURL(s.listen)
+	if err != nil {
+		return err
+	}
+	s.listener = ln
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			default:
+			}
+			return errors.Wrap(err, "sshserver: accept error")
+		}
+		go s.handleConn(ctx, conn)
+	}
+}
+
+// Close shuts down the listener and tears down every connection's active
+// forwards.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	conns := s.conns
+	s.conns = make(map[*ssh.ServerConn]*connForwards)
+	s.mu.Unlock()
+
+	for _, cf := range conns {
+		cf.closeAll()
+	}
+
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+func listenURL(raw string) (net.Listener, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid --listen-ssh value: %s", raw)
+	}
+	switch u.Scheme {
+	case "unix":
+		return net.Listen("unix", u.Path)
+	case "tcp", "":
+		host := u.Host
+		if host == "" {
+			host = u.Path
+		}
+		return net.Listen("tcp", host)
+	default:
+		return nil, errors.Errorf("unsupported --listen-ssh scheme: %s", u.Scheme)
+	}
+}
+
+func (s *Server) handleConn(ctx context.Context, conn net.Conn) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		logrus.Debugf("sshserver: handshake failed: %s", err)
+		conn.Close()
+		return
+	}
+	logrus.Infof("sshserver: client authenticated: %s", sconn.User())
+
+	cf := s.registerConn(sconn)
+	defer s.deregisterConn(sconn, cf)
+
+	go s.handleGlobalRequests(ctx, sconn, cf, reqs)
+	go s.handleChannels(ctx, sconn, chans)
+
+	go func() {
+		<-ctx.Done()
+		sconn.Close()
+	}()
+
+	// Block until the connection terminates (client hangup, ctx.Done above,
+	// or a protocol error), then let the deferred deregisterConn tear down
+	// every reverse-forward listener this connection opened. Without this,
+	// a forward outlives the client that asked for it: its bound port and
+	// acceptForwarded goroutine leak until the whole server shuts down.
+	sconn.Wait() //nolint:errcheck // error just means the connection is gone
+}
+
+// registerConn allocates the per-connection forward tracking for sconn.
+func (s *Server) registerConn(sconn *ssh.ServerConn) *connForwards {
+	cf := newConnForwards(func(id string, fwd *tcpipForward) {
+		s.unregisterExpose(id, fwd.bindAddr, fwd.bindPort)
+	})
+	s.mu.Lock()
+	s.conns[sconn] = cf
+	s.mu.Unlock()
+	return cf
+}
+
+// deregisterConn drops sconn's entry and closes any forwards it still owns.
+func (s *Server) deregisterConn(sconn *ssh.ServerConn, cf *connForwards) {
+	s.mu.Lock()
+	delete(s.conns, sconn)
+	s.mu.Unlock()
+
+	cf.closeAll()
+}
+
+func (s *Server) handleChannels(ctx context.Context, conn *ssh.ServerConn, chans <-chan ssh.NewChannel) {
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "direct-tcpip":
+			go s.handleDirectTCPIP(ctx, newChannel)
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, fmt.Sprintf("unsupported channel type: %s", newChannel.ChannelType()))
+		}
+	}
+}
+
+// directTCPIPPayload is the RFC 4254 §7.2 "direct-tcpip" open payload.
+type directTCPIPPayload struct {
+	DestAddr   string
+	DestPort   uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+func (s *Server) handleDirectTCPIP(ctx context.Context, newChannel ssh.NewChannel) {
+	var payload directTCPIPPayload
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, "malformed direct-tcpip request")
+		return
+	}
+
+	conn, err := s.vn.DialContextTCP(ctx, payload.DestAddr, uint16(payload.DestPort))
+	if err != nil {
+		logrus.Debugf("sshserver: direct-tcpip dial %s:%d failed: %s", payload.DestAddr, payload.DestPort, err)
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	bridge(channel, conn)
+}
@@ -0,0 +1,83 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// tlsConfigFromQuery builds a *tls.Config from the cert/key/cacert query
+// parameters carried on a wss:// or https+connect:// endpoint, e.g.
+// "wss://0.0.0.0:9443?cert=/etc/gvproxy/tls.crt&key=/etc/gvproxy/tls.key".
+// It returns (nil, nil) when none of those are set, meaning plaintext.
+func tlsConfigFromQuery(endpoint *url.URL) (*tls.Config, error) {
+	q := endpoint.Query()
+	cert := q.Get("cert")
+	key := q.Get("key")
+	cacert := q.Get("cacert")
+
+	if cert == "" && key == "" && cacert == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cert != "" || key != "" {
+		if cert == "" || key == "" {
+			return nil, errors.New("cert and key query parameters must be specified together")
+		}
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load TLS certificate")
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+
+	if cacert != "" {
+		raw, err := ioutil.ReadFile(cacert)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read cacert")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			return nil, errors.Errorf("no certificates found in %s", cacert)
+		}
+		config.RootCAs = pool
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// authHookFromQuery returns an AuthHook enforcing the bearer "token" query
+// parameter, if one was set on the endpoint. Callers pass the resulting hook
+// to their upgrade/handshake handler so the connection is rejected before it
+// completes.
+func authHookFromQuery(endpoint *url.URL) AuthHook {
+	token := endpoint.Query().Get("token")
+	if token == "" {
+		return nil
+	}
+	return func(r *http.Request) error {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			return errors.New("missing or invalid bearer token")
+		}
+		return nil
+	}
+}
+
+// bearerTokenFromQuery returns the "token" query parameter, if any, for
+// dialers to present as an Authorization header.
+func bearerTokenFromQuery(endpoint *url.URL) string {
+	return endpoint.Query().Get("token")
+}
+
+// AuthHook validates an incoming request before a ws/https+connect upgrade
+// completes, e.g. checking a bearer token or performing mTLS checks that
+// tls.Config.ClientAuth didn't already reject.
+type AuthHook func(r *http.Request) error
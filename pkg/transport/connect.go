@@ -0,0 +1,178 @@
+package transport
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// connectListener accepts plain (or TLS) TCP connections and expects each one
+// to open with an HTTP CONNECT request, replying 200 and then handing back
+// the raw connection so the tunneled bytes (length-prefixed Ethernet frames,
+// same as unix/vsock endpoints) flow untouched from there on. Each accepted
+// connection runs its TLS/CONNECT handshake on its own goroutine (mirroring
+// wsListener) so a slow or stalled client can't hold up the rest of the tap
+// link's accept loop.
+type connectListener struct {
+	raw       net.Listener
+	tlsConfig *tls.Config
+	auth      AuthHook
+
+	accept chan net.Conn
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func listenConnect(endpoint *url.URL) (net.Listener, error) {
+	tlsConfig, err := tlsConfigFromQuery(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := net.Listen("tcp", endpoint.Host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot listen on %s", endpoint.Host)
+	}
+
+	l := &connectListener{
+		raw:       raw,
+		tlsConfig: tlsConfig,
+		auth:      authHookFromQuery(endpoint),
+		accept:    make(chan net.Conn),
+		done:      make(chan struct{}),
+	}
+
+	go l.acceptLoop()
+
+	return l, nil
+}
+
+func (l *connectListener) acceptLoop() {
+	for {
+		conn, err := l.raw.Accept()
+		if err != nil {
+			return
+		}
+		go l.handshakeAndDeliver(conn)
+	}
+}
+
+func (l *connectListener) handshakeAndDeliver(conn net.Conn) {
+	if l.tlsConfig != nil {
+		conn = tls.Server(conn, l.tlsConfig)
+	}
+
+	upgraded, err := l.handshake(conn)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	select {
+	case l.accept <- upgraded:
+	case <-l.done:
+		upgraded.Close()
+	}
+}
+
+func (l *connectListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.accept:
+		return conn, nil
+	case <-l.done:
+		return nil, errors.New("transport: listener closed")
+	}
+}
+
+func (l *connectListener) handshake(conn net.Conn) (net.Conn, error) {
+	r := bufio.NewReader(conn)
+	req, err := http.ReadRequest(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "expected an HTTP CONNECT request")
+	}
+	if req.Method != http.MethodConnect {
+		conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+		return nil, errors.Errorf("expected CONNECT, got %s", req.Method)
+	}
+	if l.auth != nil {
+		if err := l.auth(req); err != nil {
+			conn.Write([]byte("HTTP/1.1 401 Unauthorized\r\n\r\n"))
+			return nil, err
+		}
+	}
+
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		return nil, err
+	}
+
+	// http.ReadRequest may have buffered bytes past the headers (the client
+	// is free to start sending frame data immediately); keep reading through
+	// the same bufio.Reader so none of it is dropped.
+	return &bufferedConn{Conn: conn, r: r}, nil
+}
+
+func (l *connectListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.raw.Close()
+}
+func (l *connectListener) Addr() net.Addr { return l.raw.Addr() }
+
+// bufferedConn lets Read continue through a bufio.Reader that was used to
+// parse a handshake, while Write and the rest of net.Conn pass straight
+// through to the underlying connection.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func dialConnect(endpoint *url.URL) (net.Conn, error) {
+	tlsConfig, err := tlsConfigFromQuery(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	if tlsConfig != nil {
+		conn, err = tls.Dial("tcp", endpoint.Host, tlsConfig)
+	} else {
+		conn, err = net.Dial("tcp", endpoint.Host)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot dial %s", endpoint.Host)
+	}
+
+	req := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", endpoint.Host, endpoint.Host)
+	if token := bearerTokenFromQuery(endpoint); token != "" {
+		req += fmt.Sprintf("Authorization: Bearer %s\r\n", token)
+	}
+	req += "\r\n"
+
+	if _, err := conn.Write([]byte(req)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "failed to read CONNECT response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, errors.Errorf("CONNECT rejected: %s", resp.Status)
+	}
+
+	return &bufferedConn{Conn: conn, r: r}, nil
+}
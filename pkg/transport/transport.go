@@ -0,0 +1,63 @@
+// Package transport provides the listener/dialer pair gvproxy uses to attach
+// the virtual network's tap to a guest or remote agent. The concrete
+// protocol is picked by the endpoint URL's scheme: unix, tcp, and vsock for
+// local VMs, plus ws(s):// and https+connect:// for agents that only have
+// outbound HTTPS, the same technique firewall-traversal tools like chisel
+// use.
+package transport
+
+import (
+	"net"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultURL is the default endpoint gvproxy listens for VMs/agents on.
+const DefaultURL = "unix:///tmp/network.sock"
+
+// Listen opens a listener for endpoint's scheme.
+func Listen(endpoint string) (net.Listener, error) {
+	uri, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid endpoint: %s", endpoint)
+	}
+
+	switch uri.Scheme {
+	case "unix":
+		return net.Listen("unix", uri.Path)
+	case "tcp":
+		return net.Listen("tcp", uri.Host)
+	case "vsock":
+		return listenVsock(uri)
+	case "ws", "wss":
+		return listenWebSocket(uri)
+	case "https+connect":
+		return listenConnect(uri)
+	default:
+		return nil, errors.Errorf("unexpected scheme: %s", uri.Scheme)
+	}
+}
+
+// Dial connects to endpoint's scheme, mirroring Listen.
+func Dial(endpoint string) (net.Conn, error) {
+	uri, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid endpoint: %s", endpoint)
+	}
+
+	switch uri.Scheme {
+	case "unix":
+		return net.Dial("unix", uri.Path)
+	case "tcp":
+		return net.Dial("tcp", uri.Host)
+	case "vsock":
+		return dialVsock(uri)
+	case "ws", "wss":
+		return dialWebSocket(uri)
+	case "https+connect":
+		return dialConnect(uri)
+	default:
+		return nil, errors.Errorf("unexpected scheme: %s", uri.Scheme)
+	}
+}
@@ -0,0 +1,32 @@
+//go:build linux
+
+package transport
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/mdlayher/vsock"
+	"github.com/pkg/errors"
+)
+
+func listenVsock(endpoint *url.URL) (net.Listener, error) {
+	port, err := strconv.ParseUint(endpoint.Port(), 10, 32)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid vsock port: %s", endpoint.Port())
+	}
+	return vsock.Listen(uint32(port), nil)
+}
+
+func dialVsock(endpoint *url.URL) (net.Conn, error) {
+	cid, err := strconv.ParseUint(endpoint.Hostname(), 10, 32)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid vsock cid: %s", endpoint.Hostname())
+	}
+	port, err := strconv.ParseUint(endpoint.Port(), 10, 32)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid vsock port: %s", endpoint.Port())
+	}
+	return vsock.Dial(uint32(cid), uint32(port), nil)
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package transport
+
+import (
+	"net"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+func listenVsock(endpoint *url.URL) (net.Listener, error) {
+	return nil, errors.New("vsock endpoints are only supported on Linux")
+}
+
+func dialVsock(endpoint *url.URL) (net.Conn, error) {
+	return nil, errors.New("vsock endpoints are only supported on Linux")
+}
@@ -0,0 +1,129 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/pkg/errors"
+	"nhooyr.io/websocket"
+)
+
+// wsListener adapts an http.Server upgrading every request to a WebSocket
+// into a plain net.Listener, so the rest of gvproxy (vn.AcceptQemu et al.)
+// can treat a ws(s):// endpoint exactly like a unix or vsock one.
+type wsListener struct {
+	raw    net.Listener
+	server *http.Server
+	accept chan net.Conn
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func listenWebSocket(endpoint *url.URL) (net.Listener, error) {
+	tlsConfig, err := tlsConfigFromQuery(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	auth := authHookFromQuery(endpoint)
+
+	raw, err := net.Listen("tcp", endpoint.Host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot listen on %s", endpoint.Host)
+	}
+
+	l := &wsListener{
+		raw:    raw,
+		accept: make(chan net.Conn),
+		done:   make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if auth != nil {
+			if err := auth(r); err != nil {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		// Not r.Context(): net/http cancels it as soon as this handler
+		// returns, which would close the connection just handed off.
+		conn := websocket.NetConn(context.Background(), c, websocket.MessageBinary)
+		select {
+		case l.accept <- conn:
+		case <-l.done:
+			conn.Close()
+		}
+	})
+	l.server = &http.Server{Handler: mux, TLSConfig: tlsConfig}
+
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			err = l.server.ServeTLS(raw, "", "")
+		} else {
+			err = l.server.Serve(raw)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			// The accept loop is already done; nothing left to report to.
+		}
+	}()
+
+	return l, nil
+}
+
+func (l *wsListener) Accept() (net.Conn, error) {
+	select {
+	case conn, ok := <-l.accept:
+		if !ok {
+			return nil, errors.New("transport: listener closed")
+		}
+		return conn, nil
+	case <-l.done:
+		return nil, errors.New("transport: listener closed")
+	}
+}
+
+func (l *wsListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.raw.Close()
+}
+
+func (l *wsListener) Addr() net.Addr {
+	return l.raw.Addr()
+}
+
+func dialWebSocket(endpoint *url.URL) (net.Conn, error) {
+	tlsConfig, err := tlsConfigFromQuery(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	if token := bearerTokenFromQuery(endpoint); token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	httpClient := http.DefaultClient
+	if tlsConfig != nil {
+		httpClient = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	}
+
+	ctx := context.Background()
+	c, _, err := websocket.Dial(ctx, endpoint.String(), &websocket.DialOptions{
+		HTTPClient: httpClient,
+		HTTPHeader: header,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to dial %s", endpoint)
+	}
+
+	return websocket.NetConn(ctx, c, websocket.MessageBinary), nil
+}
@@ -0,0 +1,35 @@
+package types
+
+// SSHForwardDescriptor is the JSON body POSTed to /services/forwarder/ssh to
+// create a reverse forward at runtime, mirroring gvproxy's --forward-* /
+// --forward-listen flags.
+type SSHForwardDescriptor struct {
+	// Source is the forward's listen URL, e.g. "unix:///tmp/forward.sock"
+	// or "tcp://127.0.0.1:2223".
+	Source string `json:"source"`
+	// Destination is the ssh:// URL of the target inside the guest, e.g.
+	// "ssh://core@192.168.127.2/run/podman/podman.sock".
+	Destination string `json:"destination"`
+	// Identity is a path to the SSH private key to authenticate with.
+	// Mutually exclusive with IdentityPEM.
+	Identity string `json:"identity,omitempty"`
+	// IdentityPEM is an inline PEM-encoded private key, for callers that
+	// don't want to place a key file on disk themselves.
+	IdentityPEM string `json:"identityPem,omitempty"`
+	// Passphrase is carried in the descriptor but is not applied when the
+	// forward is created: the identity key is loaded with an empty
+	// passphrase, so an encrypted Identity/IdentityPEM fails to load.
+	Passphrase string `json:"passphrase,omitempty"`
+	// HostKeyPin is a path to a known_hosts-formatted file the bastion's
+	// host key must already appear in. When empty, the destination URL's
+	// own `?secure=`/`?known-hosts=` semantics apply.
+	HostKeyPin string `json:"hostKeyPin,omitempty"`
+}
+
+// SSHForwardInfo describes a forward registered through the API.
+type SSHForwardInfo struct {
+	ID          string `json:"id"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Fingerprint string `json:"fingerprint"`
+}
@@ -0,0 +1,102 @@
+package virtualnetwork
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/containers/gvisor-tap-vsock/pkg/types"
+)
+
+// exposedForward is the bookkeeping entry behind one Expose'd forward.
+// revoke, if set, actually tears the forward down (e.g. closing the
+// reverse-forward's gonet listener); it's what lets Unexpose do more than
+// remove an entry API clients can no longer see.
+type exposedForward struct {
+	req    types.ExposeRequest
+	revoke func()
+}
+
+// Expose records req on n so that it shows up for API clients enumerating
+// active forwards under /services/forwarder/exposed on n.Mux() (see
+// RegisterExposeHandlers). It does not itself open any socket; callers are
+// responsible for the forwarding. revoke, if non-nil, is invoked by Unexpose
+// to tear the forward itself down - e.g. sshserver passes one that closes
+// the underlying reverse-forward listener - so that a DELETE through the API
+// genuinely revokes the forward instead of only removing its bookkeeping.
+func (n *VirtualNetwork) Expose(req *types.ExposeRequest, revoke func()) error {
+	n.exposedMu.Lock()
+	defer n.exposedMu.Unlock()
+	if n.exposed == nil {
+		n.exposed = make(map[string]exposedForward)
+	}
+	n.exposed[req.Local] = exposedForward{req: *req, revoke: revoke}
+	return nil
+}
+
+// Unexpose removes a previously Expose'd entry and, if it was registered
+// with a revoke callback, invokes it. It is safe to call more than once for
+// the same entry - e.g. once from the forward tearing itself down and again
+// from an API-triggered revoke racing it - since the second call finds the
+// entry already gone and does nothing.
+func (n *VirtualNetwork) Unexpose(req *types.UnexposeRequest) error {
+	n.exposedMu.Lock()
+	entry, ok := n.exposed[req.Local]
+	if ok {
+		delete(n.exposed, req.Local)
+	}
+	n.exposedMu.Unlock()
+
+	if ok && entry.revoke != nil {
+		entry.revoke()
+	}
+	return nil
+}
+
+// ExposedPorts returns a snapshot of the currently exposed forwards.
+func (n *VirtualNetwork) ExposedPorts() []types.ExposeRequest {
+	n.exposedMu.Lock()
+	defer n.exposedMu.Unlock()
+	ports := make([]types.ExposeRequest, 0, len(n.exposed))
+	for _, entry := range n.exposed {
+		ports = append(ports, entry.req)
+	}
+	return ports
+}
+
+// RegisterExposeHandlers mounts the collection and item routes that let API
+// clients enumerate and revoke the forwards tracked by Expose/Unexpose, the
+// same way SSHForwardRegistry.RegisterHandlers mounts its own routes.
+func (n *VirtualNetwork) RegisterExposeHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/services/forwarder/exposed", n.handleExposedCollection)
+	mux.HandleFunc("/services/forwarder/exposed/", n.handleExposedItem)
+}
+
+func (n *VirtualNetwork) handleExposedCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(n.ExposedPorts())
+}
+
+// handleExposedItem revokes the forward registered under the Local address
+// in the path, actually tearing it down (via the revoke callback passed to
+// Expose) rather than just dropping the bookkeeping entry.
+func (n *VirtualNetwork) handleExposedItem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	local := strings.TrimPrefix(r.URL.Path, "/services/forwarder/exposed/")
+	if local == "" {
+		http.Error(w, "missing forward address", http.StatusBadRequest)
+		return
+	}
+	if err := n.Unexpose(&types.UnexposeRequest{Local: local}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
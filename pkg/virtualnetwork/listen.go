@@ -0,0 +1,62 @@
+package virtualnetwork
+
+import (
+	"context"
+	"net"
+
+	"github.com/pkg/errors"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+)
+
+// ListenTCP opens a TCP listener directly on the virtual network's gvisor
+// stack, so that in-process servers (such as an SSH reverse-forward
+// listener) can accept connections originating from the guest. addr may be
+// empty to bind all virtual addresses. Passing port 0 requests an ephemeral
+// port; the caller can recover the assigned port from the returned
+// listener's Addr().
+func (n *VirtualNetwork) ListenTCP(addr string, port uint16) (net.Listener, error) {
+	full := tcpip.FullAddress{NIC: 1, Port: port}
+	if addr != "" && addr != "0.0.0.0" {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, errors.Errorf("invalid bind address: %s", addr)
+		}
+		full.Addr = tcpip.Address(ip.To4())
+	}
+	return gonet.ListenTCP(n.stack, full, ipv4.ProtocolNumber)
+}
+
+// DialContextTCP dials a destination inside the virtual network, the same
+// way CreateSSHForward's connectFunc does for the bastion connection. It is
+// exported so that other front-ends (e.g. pkg/sshserver's direct-tcpip
+// handling) can reach hosts on the subnet without reimplementing the gonet
+// plumbing.
+func (n *VirtualNetwork) DialContextTCP(ctx context.Context, addr string, port uint16) (net.Conn, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, errors.Errorf("invalid destination address: %s", addr)
+	}
+	return gonet.DialContextTCP(ctx, n.stack, tcpip.FullAddress{
+		NIC:  1,
+		Addr: tcpip.Address(ip.To4()),
+		Port: port,
+	}, ipv4.ProtocolNumber)
+}
+
+// DialUDP dials a UDP destination inside the virtual network, for callers
+// (e.g. pkg/socks5's UDP ASSOCIATE handling) that need to relay datagrams
+// through the gvisor stack rather than the host's own network.
+func (n *VirtualNetwork) DialUDP(addr string, port uint16) (net.Conn, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, errors.Errorf("invalid destination address: %s", addr)
+	}
+	raddr := tcpip.FullAddress{
+		NIC:  1,
+		Addr: tcpip.Address(ip.To4()),
+		Port: port,
+	}
+	return gonet.DialUDP(n.stack, nil, &raddr, ipv4.ProtocolNumber)
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package virtualnetwork
+
+import (
+	"net"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	listenerFactories["npipe"] = func(socketURI *url.URL) (net.Listener, error) {
+		return nil, errors.New("npipe forward sources are only supported on Windows")
+	}
+}
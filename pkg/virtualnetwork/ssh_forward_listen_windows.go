@@ -0,0 +1,18 @@
+//go:build windows
+
+package virtualnetwork
+
+import (
+	"net"
+	"net/url"
+
+	"github.com/Microsoft/go-winio"
+)
+
+func init() {
+	listenerFactories["npipe"] = listenNamedPipe
+}
+
+func listenNamedPipe(socketURI *url.URL) (net.Listener, error) {
+	return winio.ListenPipe(socketURI.Path, nil)
+}
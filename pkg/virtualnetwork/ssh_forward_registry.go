@@ -0,0 +1,228 @@
+package virtualnetwork
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/containers/gvisor-tap-vsock/pkg/sshclient"
+	"github.com/containers/gvisor-tap-vsock/pkg/types"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// SSHForwardRegistry tracks SSH forwards created at runtime through the API,
+// so they can be enumerated and torn down independently of the static
+// --forward-* flags, the same way the Forwards/NAT/Expose maps are already
+// dynamically manipulated elsewhere.
+type SSHForwardRegistry struct {
+	ctx context.Context
+	vn  *VirtualNetwork
+
+	mu      sync.Mutex
+	entries map[string]*registeredForward
+}
+
+type registeredForward struct {
+	forward    *SSHForward
+	descriptor types.SSHForwardDescriptor
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+// NewSSHForwardRegistry creates an empty registry. Forwards it creates run
+// until ctx is canceled or they are individually deleted.
+func NewSSHForwardRegistry(ctx context.Context, vn *VirtualNetwork) *SSHForwardRegistry {
+	return &SSHForwardRegistry{ctx: ctx, vn: vn, entries: make(map[string]*registeredForward)}
+}
+
+// RegisterHandlers mounts the collection and item routes on mux.
+func (reg *SSHForwardRegistry) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/services/forwarder/ssh", reg.handleCollection)
+	mux.HandleFunc("/services/forwarder/ssh/", reg.handleItem)
+}
+
+func (reg *SSHForwardRegistry) handleCollection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		reg.list(w)
+	case http.MethodPost:
+		reg.create(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (reg *SSHForwardRegistry) handleItem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/services/forwarder/ssh/")
+	if id == "" {
+		http.Error(w, "missing forward id", http.StatusBadRequest)
+		return
+	}
+	if !reg.delete(id) {
+		http.Error(w, "no such forward", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (reg *SSHForwardRegistry) list(w http.ResponseWriter) {
+	reg.mu.Lock()
+	infos := make([]types.SSHForwardInfo, 0, len(reg.entries))
+	for id, entry := range reg.entries {
+		infos = append(infos, types.SSHForwardInfo{
+			ID:          id,
+			Source:      entry.descriptor.Source,
+			Destination: entry.descriptor.Destination,
+			Fingerprint: entry.forward.HostKeyFingerprint(),
+		})
+	}
+	reg.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(infos)
+}
+
+func (reg *SSHForwardRegistry) create(w http.ResponseWriter, r *http.Request) {
+	var descriptor types.SSHForwardDescriptor
+	if err := json.NewDecoder(r.Body).Decode(&descriptor); err != nil {
+		http.Error(w, errors.Wrap(err, "invalid request body").Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, entry, err := reg.start(descriptor)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(types.SSHForwardInfo{
+		ID:          id,
+		Source:      descriptor.Source,
+		Destination: descriptor.Destination,
+		Fingerprint: entry.forward.HostKeyFingerprint(),
+	})
+}
+
+func (reg *SSHForwardRegistry) start(descriptor types.SSHForwardDescriptor) (string, *registeredForward, error) {
+	dest, err := url.Parse(descriptor.Destination)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "invalid destination")
+	}
+
+	identity, cleanup, err := resolveIdentity(descriptor)
+	if err != nil {
+		return "", nil, err
+	}
+	defer cleanup()
+
+	var hostKeys sshclient.HostKeyStore
+	if descriptor.HostKeyPin != "" {
+		hostKeys = sshclient.NewFileHostKeyStore(descriptor.HostKeyPin)
+	}
+
+	ctx, cancel := context.WithCancel(reg.ctx)
+	forward, err := CreateSSHForwardFromSource(ctx, descriptor.Source, *dest, identity, reg.vn, hostKeys)
+	if err != nil {
+		cancel()
+		return "", nil, err
+	}
+
+	id, err := randomID()
+	if err != nil {
+		cancel()
+		forward.Close()
+		return "", nil, err
+	}
+
+	entry := &registeredForward{forward: forward, descriptor: descriptor, ctx: ctx, cancel: cancel}
+
+	reg.mu.Lock()
+	reg.entries[id] = entry
+	reg.mu.Unlock()
+
+	go reg.serve(id, entry)
+
+	return id, entry, nil
+}
+
+func (reg *SSHForwardRegistry) serve(id string, entry *registeredForward) {
+	for {
+		select {
+		case <-entry.ctx.Done():
+			return
+		default:
+		}
+		if err := entry.forward.AcceptAndTunnel(entry.ctx); err != nil {
+			logrus.Debugf("ssh forward %s: %s", id, err)
+		}
+	}
+}
+
+func (reg *SSHForwardRegistry) delete(id string) bool {
+	reg.mu.Lock()
+	entry, ok := reg.entries[id]
+	if ok {
+		delete(reg.entries, id)
+	}
+	reg.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+	entry.cancel()
+	entry.forward.Close()
+	return true
+}
+
+func resolveIdentity(descriptor types.SSHForwardDescriptor) (path string, cleanup func(), err error) {
+	noop := func() {}
+	if descriptor.Identity != "" && descriptor.IdentityPEM != "" {
+		return "", noop, errors.New("identity and identityPem are mutually exclusive")
+	}
+	if descriptor.Identity != "" {
+		return descriptor.Identity, noop, nil
+	}
+	if descriptor.IdentityPEM == "" {
+		return "", noop, nil
+	}
+
+	f, err := ioutil.TempFile("", "gvproxy-identity-")
+	if err != nil {
+		return "", noop, errors.Wrap(err, "failed to stage inline identity")
+	}
+	if err := os.Chmod(f.Name(), 0600); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", noop, err
+	}
+	if _, err := f.WriteString(descriptor.IdentityPEM); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", noop, err
+	}
+	f.Close()
+
+	return f.Name(), func() { os.Remove(f.Name()) }, nil
+}
+
+func randomID() (string, error) {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
@@ -11,43 +11,94 @@ import (
 
 	"github.com/containers/gvisor-tap-vsock/pkg/fs"
 	"github.com/containers/gvisor-tap-vsock/pkg/sshclient"
+	"github.com/containers/gvisor-tap-vsock/pkg/transport"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/crypto/ssh"
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
 )
 
-type CloseWriteStream interface {
-	io.Reader
-	io.WriteCloser
+// halfCloser is implemented by listener/connection types that can signal EOF
+// to their peer without fully closing, e.g. unix and TCP sockets. Types that
+// don't support it (Windows named pipes) are handled by falling back to a
+// full Close once the copy in that direction is done.
+type halfCloser interface {
 	CloseWrite() error
 }
 
+// listenerFactory constructs a net.Listener for a forward source URL. Each
+// supported scheme (unix, tcp, vsock, npipe) registers one in
+// listenerFactories, so adding a new source type doesn't require touching
+// setupProxy.
+type listenerFactory func(*url.URL) (net.Listener, error)
+
+var listenerFactories = map[string]listenerFactory{
+	"unix":  listenUnix,
+	"tcp":   listenTCP,
+	"vsock": listenVsock,
+}
+
 type SSHForward struct {
 	listener net.Listener
 	bastion  *sshclient.Bastion
 	sock     *url.URL
 }
 
-func CreateSSHForward(ctx context.Context, socket string, dest url.URL, identity string, vn *VirtualNetwork) (*SSHForward, error) {
-	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
-		return &SSHForward{}, err
+// CreateSSHForward listens on a unix socket and relays connections to dest
+// over an SSH tunnel via the virtual network. It is kept for compatibility
+// with callers that only deal in unix socket paths; new callers that want a
+// TCP, vsock, or (on Windows) named-pipe source should use
+// CreateSSHForwardFromSource instead. hostKeys may be nil to fall back to
+// the dest URL's own `?secure=true`/`?known-hosts=` semantics.
+func CreateSSHForward(ctx context.Context, socket string, dest url.URL, identity string, vn *VirtualNetwork, hostKeys sshclient.HostKeyStore) (*SSHForward, error) {
+	src := &url.URL{Scheme: "unix", Path: socket}
+	return setupProxy(ctx, src, &dest, identity, vn, hostKeys)
+}
+
+// CreateSSHForwardFromSource is like CreateSSHForward, but source is a full
+// URL whose scheme picks the listener factory: unix://<path>, tcp://<host:port>,
+// vsock://<cid:port> (delegated to pkg/transport), or npipe://<path> (Windows only).
+func CreateSSHForwardFromSource(ctx context.Context, source string, dest url.URL, identity string, vn *VirtualNetwork, hostKeys sshclient.HostKeyStore) (*SSHForward, error) {
+	src, err := url.Parse(source)
+	if err != nil {
+		return &SSHForward{}, errors.Wrapf(err, "invalid forward source: %s", source)
 	}
+	return setupProxy(ctx, src, &dest, identity, vn, hostKeys)
+}
 
-	src := url.URL{
-		Scheme: "unix",
-		Path:   socket,
+// AddListener binds an additional source listener that forwards to the same
+// destination over forward's already-established bastion connection, so that
+// several local sources (e.g. one unix socket and several tcp addresses) can
+// share a single SSH session instead of reconnecting for each.
+func (forward *SSHForward) AddListener(source string) (*SSHForward, error) {
+	src, err := url.Parse(source)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid forward source: %s", source)
 	}
 
-	return setupProxy(ctx, &src, &dest, identity, vn)
+	listener, err := listen(src)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("Socket forward listening on: %s\n", src)
+
+	return &SSHForward{listener: listener, bastion: forward.bastion, sock: src}, nil
 }
 
 func (forward *SSHForward) AcceptAndTunnel(ctx context.Context) error {
 	return acceptConnection(ctx, forward.listener, forward.bastion, forward.sock)
 }
 
+// HostKeyFingerprint returns the SHA256 fingerprint of the bastion's host
+// key, so API clients can verify it out of band (e.g. against what they
+// expect to see printed on first connect). It is "" when the bastion's host
+// key is not verified.
+func (forward *SSHForward) HostKeyFingerprint() string {
+	return forward.bastion.Fingerprint()
+}
+
 func (forward *SSHForward) Close() {
 	if forward.listener != nil {
 		forward.listener.Close()
@@ -57,11 +108,11 @@ func (forward *SSHForward) Close() {
 	}
 }
 
-func connectForward(ctx context.Context, bastion *sshclient.Bastion) (CloseWriteStream, error) {
+func connectForward(ctx context.Context, bastion *sshclient.Bastion) (net.Conn, error) {
 	for retries := 1; ; retries++ {
 		forward, err := bastion.Client.Dial("unix", bastion.Path)
 		if err == nil {
-			return forward.(ssh.Channel), nil
+			return forward, nil
 		}
 		if retries > 2 {
 			return nil, errors.Wrapf(err, "Couldn't restablish ssh tunnel on path: %s", bastion.Path)
@@ -87,6 +138,10 @@ func connectForward(ctx context.Context, bastion *sshclient.Bastion) (CloseWrite
 }
 
 func listenUnix(socketURI *url.URL) (net.Listener, error) {
+	if err := os.Remove(socketURI.Path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
 	oldmask := fs.Umask(0177)
 	defer fs.Umask(oldmask)
 	listener, err := net.Listen("unix", socketURI.Path)
@@ -97,13 +152,33 @@ func listenUnix(socketURI *url.URL) (net.Listener, error) {
 	return listener, nil
 }
 
-func setupProxy(ctx context.Context, socketURI *url.URL, dest *url.URL, identity string, vn *VirtualNetwork) (*SSHForward, error) {
+func listenTCP(socketURI *url.URL) (net.Listener, error) {
+	listener, err := net.Listen("tcp", socketURI.Host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error listening on socket: %s", socketURI.Host)
+	}
+	return listener, nil
+}
+
+func listenVsock(socketURI *url.URL) (net.Listener, error) {
+	return transport.Listen(socketURI.String())
+}
+
+func listen(socketURI *url.URL) (net.Listener, error) {
+	factory, ok := listenerFactories[socketURI.Scheme]
+	if !ok {
+		return nil, errors.Errorf("unsupported forward source scheme: %s", socketURI.Scheme)
+	}
+	return factory(socketURI)
+}
+
+func setupProxy(ctx context.Context, socketURI *url.URL, dest *url.URL, identity string, vn *VirtualNetwork, hostKeys sshclient.HostKeyStore) (*SSHForward, error) {
 	port, err := strconv.Atoi(dest.Port())
 	if err != nil {
 		return &SSHForward{}, errors.Errorf("Invalid port for ssh forward: %s", dest.Port())
 	}
 
-	listener, err := listenUnix(socketURI)
+	listener, err := listen(socketURI)
 	if err != nil {
 		return &SSHForward{}, err
 	}
@@ -134,7 +209,7 @@ func setupProxy(ctx context.Context, socketURI *url.URL, dest *url.URL, identity
 		return &SSHForward{}, err
 	}
 
-	bastion, err := sshclient.CreateBastion(dest, "", identity, conn, connectFunc)
+	bastion, err := sshclient.CreateBastion(dest, "", identity, conn, connectFunc, hostKeys)
 	if err != nil {
 		return &SSHForward{}, err
 	}
@@ -173,22 +248,14 @@ loop:
 }
 
 func acceptConnection(ctx context.Context, listener net.Listener, bastion *sshclient.Bastion, socketURI *url.URL) error {
-	con, err := listener.Accept()
+	src, err := listener.Accept()
 	if err != nil {
-		return errors.Wrapf(err, "Error accepting on socket: %s", socketURI.Path)
-	}
-
-	src, ok := con.(CloseWriteStream)
-	if !ok {
-		con.Close()
-		return errors.Wrapf(err, "Underlying socket does not support half-close %s", socketURI.Path)
+		return errors.Wrapf(err, "Error accepting on socket: %s", socketURI)
 	}
 
-	var dest CloseWriteStream
-
-	dest, err = connectForward(ctx, bastion)
+	dest, err := connectForward(ctx, bastion)
 	if err != nil {
-		con.Close()
+		src.Close()
 		logrus.Error(err)
 		return nil // eat
 	}
@@ -199,12 +266,18 @@ func acceptConnection(ctx context.Context, listener net.Listener, bastion *sshcl
 	return nil
 }
 
-func forward(src io.ReadCloser, dest CloseWriteStream) {
+func forward(src, dest net.Conn) {
 	defer src.Close()
 	_, _ = io.Copy(dest, src)
 
-	// Trigger an EOF on the other end
-	_ = dest.CloseWrite()
+	// Trigger an EOF on the other end. Prefer a half-close so the
+	// connection can still drain its other direction; fall back to a full
+	// close for stream types that don't support it (e.g. Windows named pipes).
+	if hc, ok := dest.(halfCloser); ok {
+		_ = hc.CloseWrite()
+	} else {
+		_ = dest.Close()
+	}
 }
 
 func backOff(delay time.Duration) time.Duration {